@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AbuseConfig controls the anti-abuse layer sitting in front of the
+// contact form endpoint. Each protection is independently toggleable so
+// an operator can run with none, one, or all of them.
+type AbuseConfig struct {
+	RateLimitEnabled bool
+	RateLimitRPS     float64
+	RateLimitBurst   int
+
+	CaptchaEnabled   bool
+	CaptchaSecret    string
+	CaptchaVerifyURL string
+
+	HoneypotEnabled bool
+
+	// TrustedProxyCount is how many hops of reverse proxy sit in front
+	// of this server. It is 0 unless TRUSTED_PROXY_COUNT is set; while
+	// it is 0, X-Forwarded-For is ignored entirely and every
+	// per-IP check keys on r.RemoteAddr: a public-facing server with
+	// no configured proxy would otherwise let any caller pick their
+	// own rate-limit bucket by setting the header themselves.
+	TrustedProxyCount int
+}
+
+// AbuseConfigFromEnv builds an AbuseConfig from:
+//   - RATE_LIMIT_RPS / RATE_LIMIT_BURST: per-IP token bucket, disabled
+//     unless RATE_LIMIT_RPS is set.
+//   - CAPTCHA_SECRET / CAPTCHA_VERIFY_URL: hCaptcha/Turnstile
+//     verification, disabled unless CAPTCHA_SECRET is set.
+//     CAPTCHA_VERIFY_URL defaults to hCaptcha's siteverify endpoint.
+//   - HONEYPOT_DISABLED: the honeypot field check is on by default,
+//     set this to "true" to turn it off.
+//   - TRUSTED_PROXY_COUNT: number of trusted reverse proxy hops in
+//     front of this server; unset (0) means X-Forwarded-For is never
+//     trusted and r.RemoteAddr is used instead.
+func AbuseConfigFromEnv() (AbuseConfig, error) {
+	cfg := AbuseConfig{
+		HoneypotEnabled:  true,
+		CaptchaVerifyURL: "https://hcaptcha.com/siteverify",
+	}
+
+	if v := os.Getenv("RATE_LIMIT_RPS"); v != "" {
+		rps, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return AbuseConfig{}, fmt.Errorf("RATE_LIMIT_RPS must be a number: %w", err)
+		}
+		burst := 5
+		if b := os.Getenv("RATE_LIMIT_BURST"); b != "" {
+			parsed, err := strconv.Atoi(b)
+			if err != nil {
+				return AbuseConfig{}, fmt.Errorf("RATE_LIMIT_BURST must be an integer: %w", err)
+			}
+			burst = parsed
+		}
+		cfg.RateLimitEnabled = true
+		cfg.RateLimitRPS = rps
+		cfg.RateLimitBurst = burst
+	}
+
+	if secret := os.Getenv("CAPTCHA_SECRET"); secret != "" {
+		cfg.CaptchaEnabled = true
+		cfg.CaptchaSecret = secret
+		if v := os.Getenv("CAPTCHA_VERIFY_URL"); v != "" {
+			cfg.CaptchaVerifyURL = v
+		}
+	}
+
+	if v := os.Getenv("HONEYPOT_DISABLED"); v != "" {
+		disabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return AbuseConfig{}, fmt.Errorf("HONEYPOT_DISABLED must be a bool: %w", err)
+		}
+		cfg.HoneypotEnabled = !disabled
+	}
+
+	if v := os.Getenv("TRUSTED_PROXY_COUNT"); v != "" {
+		count, err := strconv.Atoi(v)
+		if err != nil {
+			return AbuseConfig{}, fmt.Errorf("TRUSTED_PROXY_COUNT must be an integer: %w", err)
+		}
+		if count < 0 {
+			return AbuseConfig{}, fmt.Errorf("TRUSTED_PROXY_COUNT must not be negative")
+		}
+		cfg.TrustedProxyCount = count
+	}
+
+	return cfg, nil
+}
+
+// clientIP returns the address a per-client check (rate limiting,
+// captcha verification) should key on. X-Forwarded-For is only
+// consulted when cfg.TrustedProxyCount says a reverse proxy is
+// actually in front of us; it is client-supplied and otherwise trivial
+// to spoof a fresh value per request. When it is trusted, the entry
+// TrustedProxyCount hops back from the end of the list is used, since
+// each trusted proxy appends its own hop and that's the first entry a
+// proxy couldn't have overwritten. Anything else falls back to the
+// connection's remote address.
+func clientIP(r *http.Request, cfg AbuseConfig) string {
+	if cfg.TrustedProxyCount > 0 {
+		if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+			hops := strings.Split(fwd, ",")
+			if idx := len(hops) - cfg.TrustedProxyCount - 1; idx >= 0 {
+				if ip := strings.TrimSpace(hops[idx]); ip != "" {
+					return ip
+				}
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// tokenBucket is a minimal per-IP rate limiter: each bucket refills at
+// RateLimitRPS tokens/sec up to RateLimitBurst, and a request is allowed
+// only if a token is available.
+type tokenBucket struct {
+	tokens     float64
+	lastRefill time.Time
+}
+
+// bucketStaleAfter and bucketSweepInterval bound how long an idle
+// client's bucket is kept around, so the map can't grow without bound
+// as distinct IPs (or, with a trusted proxy configured, distinct
+// X-Forwarded-For values) pass through.
+const (
+	bucketStaleAfter    = 10 * time.Minute
+	bucketSweepInterval = time.Minute
+)
+
+// rateLimiter holds one tokenBucket per client IP.
+type rateLimiter struct {
+	cfg AbuseConfig
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+func newRateLimiter(cfg AbuseConfig) *rateLimiter {
+	rl := &rateLimiter{cfg: cfg, buckets: make(map[string]*tokenBucket)}
+	go rl.sweepStaleBuckets()
+	return rl
+}
+
+// sweepStaleBuckets periodically evicts buckets that haven't seen a
+// request in bucketStaleAfter, so a burst of one-off or spoofed
+// clients doesn't pin memory forever. It runs for the lifetime of the
+// process, same as the mail queue workers.
+func (rl *rateLimiter) sweepStaleBuckets() {
+	ticker := time.NewTicker(bucketSweepInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		cutoff := time.Now().Add(-bucketStaleAfter)
+		rl.mu.Lock()
+		for ip, b := range rl.buckets {
+			if b.lastRefill.Before(cutoff) {
+				delete(rl.buckets, ip)
+			}
+		}
+		rl.mu.Unlock()
+	}
+}
+
+// allow reports whether ip has a token available right now, consuming
+// one if so.
+func (rl *rateLimiter) allow(ip string) bool {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := time.Now()
+	b, ok := rl.buckets[ip]
+	if !ok {
+		b = &tokenBucket{tokens: float64(rl.cfg.RateLimitBurst), lastRefill: now}
+		rl.buckets[ip] = b
+	}
+
+	elapsed := now.Sub(b.lastRefill).Seconds()
+	b.tokens += elapsed * rl.cfg.RateLimitRPS
+	if max := float64(rl.cfg.RateLimitBurst); b.tokens > max {
+		b.tokens = max
+	}
+	b.lastRefill = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// rateLimitMiddleware rejects requests over the configured per-IP rate
+// with 429 Too Many Requests. It is a no-op when rate limiting is
+// disabled.
+func rateLimitMiddleware(cfg AbuseConfig, next http.Handler) http.Handler {
+	if !cfg.RateLimitEnabled {
+		return next
+	}
+	limiter := newRateLimiter(cfg)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !limiter.allow(clientIP(r, cfg)) {
+			http.Error(w, "Too many requests, slow down.", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// captchaVerifyResponse is the subset of the hCaptcha/Turnstile
+// siteverify response we care about; both providers use this shape.
+type captchaVerifyResponse struct {
+	Success bool `json:"success"`
+}
+
+// verifyCaptcha POSTs token to cfg.CaptchaVerifyURL along with the
+// shared secret and the submitter's IP, and reports whether the
+// provider accepted it.
+func verifyCaptcha(cfg AbuseConfig, token string, remoteIP string) (bool, error) {
+	form := url.Values{
+		"secret":   {cfg.CaptchaSecret},
+		"response": {token},
+		"remoteip": {remoteIP},
+	}
+
+	resp, err := http.Post(cfg.CaptchaVerifyURL, "application/x-www-form-urlencoded", bytes.NewBufferString(form.Encode()))
+	if err != nil {
+		return false, fmt.Errorf("captcha: verify request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result captchaVerifyResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return false, fmt.Errorf("captcha: decoding verify response: %w", err)
+	}
+
+	return result.Success, nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRateLimitMiddlewareBlocksBurstOverflow(t *testing.T) {
+	cfg := AbuseConfig{RateLimitEnabled: true, RateLimitRPS: 1, RateLimitBurst: 1}
+	calls := 0
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := rateLimitMiddleware(cfg, next)
+
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.RemoteAddr = "203.0.113.5:1234"
+
+	first := httptest.NewRecorder()
+	handler.ServeHTTP(first, req)
+	if first.Code != http.StatusOK {
+		t.Fatalf("expected first request to pass, got %d", first.Code)
+	}
+
+	second := httptest.NewRecorder()
+	handler.ServeHTTP(second, req)
+	if second.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected second request within the same burst to be rate limited, got %d", second.Code)
+	}
+
+	if calls != 1 {
+		t.Errorf("expected next handler to run exactly once, got %d", calls)
+	}
+}
+
+func TestClientIPIgnoresForwardedForWithoutTrustedProxy(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.RemoteAddr = "203.0.113.5:1234"
+	req.Header.Set("X-Forwarded-For", "198.51.100.9")
+
+	if ip := clientIP(req, AbuseConfig{}); ip != "203.0.113.5" {
+		t.Fatalf("expected X-Forwarded-For to be ignored without a trusted proxy, got %q", ip)
+	}
+}
+
+func TestClientIPUsesForwardedForWithTrustedProxy(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.RemoteAddr = "203.0.113.5:1234"
+	req.Header.Set("X-Forwarded-For", "198.51.100.9, 203.0.113.5")
+
+	if ip := clientIP(req, AbuseConfig{TrustedProxyCount: 1}); ip != "198.51.100.9" {
+		t.Fatalf("expected the hop before the trusted proxy to be used, got %q", ip)
+	}
+}
+
+func TestRateLimitMiddlewareKeyedOnSpoofedForwardedForIsRejected(t *testing.T) {
+	cfg := AbuseConfig{RateLimitEnabled: true, RateLimitRPS: 1, RateLimitBurst: 1}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := rateLimitMiddleware(cfg, next)
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.RemoteAddr = "203.0.113.5:1234"
+		req.Header.Set("X-Forwarded-For", strings.Repeat("a", i+1)+".example")
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if i == 1 && rec.Code != http.StatusTooManyRequests {
+			t.Fatalf("expected a spoofed X-Forwarded-For to still be rate limited on RemoteAddr, got %d", rec.Code)
+		}
+	}
+}
+
+func TestMailHandlerRejectsHoneypot(t *testing.T) {
+	cfg, replyTemplate := testFormConfig(t)
+
+	mailer := &fakeSmtp{}
+	queue := NewMailQueue(mailer, 1, 10, "")
+	attachmentCfg, err := attachmentConfigFromEnv()
+	if err != nil {
+		t.Fatalf("unexpected error building attachment config: %v", err)
+	}
+	handler := newFormHandler(cfg, replyTemplate, queue, AbuseConfig{HoneypotEnabled: true}, attachmentCfg)
+
+	body := `{"Name":"Bot","Email":"bot@example.com","Title":"Hi","Body":"spam","Website":"http://spam.example"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/contactFormEmail", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	handler(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected honeypot submission to be rejected with 400, got %d", rec.Code)
+	}
+	if len(mailer.sentMessages()) != 0 {
+		t.Errorf("expected no mail to be sent for a honeypot submission")
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// attachment is a single base64-encoded file submitted alongside a
+// contact form message. It is only ever included on the forward email
+// sent to the private address, never on the auto-reply.
+type attachment struct {
+	Filename    string
+	ContentType string
+	Size        int64
+	// Data is the file contents, base64 encoded.
+	Data string
+}
+
+// attachmentConfig bounds how much attachment data a single submission
+// may carry, and which content types are accepted.
+type attachmentConfig struct {
+	MaxAttachmentBytes int64
+	MaxTotalBytes      int64
+	AllowedTypes       map[string]bool
+}
+
+// defaultAllowedAttachmentTypes is used when ATTACHMENT_ALLOWED_TYPES is
+// not set.
+var defaultAllowedAttachmentTypes = []string{
+	"image/png",
+	"image/jpeg",
+	"image/gif",
+	"application/pdf",
+	"text/plain",
+}
+
+// attachmentConfigFromEnv builds an attachmentConfig from
+// ATTACHMENT_MAX_BYTES (per attachment, default 5MB),
+// ATTACHMENT_MAX_TOTAL_BYTES (default 15MB), and a comma delimited
+// ATTACHMENT_ALLOWED_TYPES (default: image/png, image/jpeg, image/gif,
+// application/pdf, text/plain).
+func attachmentConfigFromEnv() (attachmentConfig, error) {
+	maxAttachment, err := intEnvOrDefault("ATTACHMENT_MAX_BYTES", 5*1024*1024)
+	if err != nil {
+		return attachmentConfig{}, err
+	}
+	maxTotal, err := intEnvOrDefault("ATTACHMENT_MAX_TOTAL_BYTES", 15*1024*1024)
+	if err != nil {
+		return attachmentConfig{}, err
+	}
+
+	allowed := defaultAllowedAttachmentTypes
+	if v := os.Getenv("ATTACHMENT_ALLOWED_TYPES"); v != "" {
+		allowed = strings.Split(v, ",")
+	}
+	allowedSet := make(map[string]bool, len(allowed))
+	for _, t := range allowed {
+		allowedSet[strings.TrimSpace(t)] = true
+	}
+
+	return attachmentConfig{
+		MaxAttachmentBytes: maxAttachment,
+		MaxTotalBytes:      maxTotal,
+		AllowedTypes:       allowedSet,
+	}, nil
+}
+
+// intEnvOrDefault parses name as an int64, falling back to def when the
+// env var is unset.
+func intEnvOrDefault(name string, def int64) (int64, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+	parsed, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be an integer: %w", name, err)
+	}
+	return parsed, nil
+}
+
+// validateAttachments checks each attachment's declared size against
+// cfg, confirms it decodes to that many bytes, and rejects content
+// types that are not on the allowlist. It returns the field name to
+// report back to the client on the first violation.
+func validateAttachments(attachments []attachment, cfg attachmentConfig) (field string, reason string, ok bool) {
+	var total int64
+	for i, a := range attachments {
+		field := fmt.Sprintf("Attachments[%d]", i)
+
+		if !cfg.AllowedTypes[a.ContentType] {
+			return field, "content type not allowed", false
+		}
+		if a.Size <= 0 || a.Size > cfg.MaxAttachmentBytes {
+			return field, "exceeds per-attachment size limit", false
+		}
+
+		decoded, err := base64.StdEncoding.DecodeString(a.Data)
+		if err != nil {
+			return field, "data is not valid base64", false
+		}
+		if int64(len(decoded)) != a.Size {
+			return field, "declared size does not match data", false
+		}
+
+		total += a.Size
+		if total > cfg.MaxTotalBytes {
+			return field, "exceeds total attachment size limit", false
+		}
+	}
+	return "", "", true
+}
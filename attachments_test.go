@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestValidateAttachments(t *testing.T) {
+	cfg := attachmentConfig{
+		MaxAttachmentBytes: 10,
+		MaxTotalBytes:      15,
+		AllowedTypes:       map[string]bool{"text/plain": true},
+	}
+
+	data := base64.StdEncoding.EncodeToString([]byte("hello"))
+
+	if _, _, ok := validateAttachments([]attachment{
+		{Filename: "a.txt", ContentType: "text/plain", Size: 5, Data: data},
+	}, cfg); !ok {
+		t.Fatalf("expected a single valid attachment to pass")
+	}
+
+	if _, _, ok := validateAttachments([]attachment{
+		{Filename: "a.exe", ContentType: "application/x-msdownload", Size: 5, Data: data},
+	}, cfg); ok {
+		t.Fatalf("expected disallowed content type to fail")
+	}
+
+	if _, _, ok := validateAttachments([]attachment{
+		{Filename: "a.txt", ContentType: "text/plain", Size: 4, Data: data},
+	}, cfg); ok {
+		t.Fatalf("expected declared size mismatch to fail")
+	}
+
+	overCapCfg := cfg
+	overCapCfg.MaxTotalBytes = 14
+
+	if _, _, ok := validateAttachments([]attachment{
+		{Filename: "a.txt", ContentType: "text/plain", Size: 5, Data: data},
+		{Filename: "b.txt", ContentType: "text/plain", Size: 10, Data: base64.StdEncoding.EncodeToString([]byte("0123456789"))},
+	}, overCapCfg); ok {
+		t.Fatalf("expected total size over cap to fail")
+	}
+}
+
+// TestMailHandlerAcceptsAtCapAttachment posts a single attachment whose
+// raw size equals MaxTotalBytes through the real HTTP path, so the
+// base64-inflated request body must still fit under maxBodyBytes in
+// newFormHandler rather than being rejected by http.MaxBytesReader
+// before validateAttachments ever runs.
+func TestMailHandlerAcceptsAtCapAttachment(t *testing.T) {
+	cfg, replyTemplate := testFormConfig(t)
+
+	mailer := &fakeSmtp{}
+	queue := NewMailQueue(mailer, 1, 10, "")
+	attachmentCfg := attachmentConfig{
+		MaxAttachmentBytes: 9000,
+		MaxTotalBytes:      9000,
+		AllowedTypes:       map[string]bool{"text/plain": true},
+	}
+	handler := newFormHandler(cfg, replyTemplate, queue, AbuseConfig{HoneypotEnabled: true}, attachmentCfg)
+
+	raw := bytes.Repeat([]byte("a"), int(attachmentCfg.MaxTotalBytes))
+	data := base64.StdEncoding.EncodeToString(raw)
+
+	reqBody, err := json.Marshal(incomingMessage{
+		Name:  "Ada",
+		Email: "ada@example.com",
+		Title: "Hi",
+		Body:  "Hello there",
+		Attachments: []attachment{
+			{Filename: "a.txt", ContentType: "text/plain", Size: int64(len(raw)), Data: data},
+		},
+	})
+	if err != nil {
+		t.Fatalf("marshaling request body: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/contactFormEmail", bytes.NewReader(reqBody))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	handler(rec, req)
+
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected an at-cap attachment to be accepted with 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
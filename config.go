@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// FormConfig describes one contact form this server answers for: the
+// path it's served on, who may submit to it (CORS), where submissions
+// get forwarded, and the templates used to build the two outgoing
+// emails. Everything that used to be a "Spencer Hemstreet" string
+// literal in the email builders lives here instead.
+type FormConfig struct {
+	// Path is the mux pattern this form is served on, e.g.
+	// "/api/v1/contactFormEmail".
+	Path string `json:"path"`
+	// AllowedOrigins is this form's own CORS allowlist.
+	AllowedOrigins []string `json:"allowedOrigins"`
+
+	// PublicEmail is the address replies and forwards are sent from.
+	PublicEmail string `json:"publicEmail"`
+	// PrivateEmail is where the forwarded submission goes.
+	PrivateEmail string `json:"privateEmail"`
+	// FromName is the display name on the From header, e.g. "Spencer Hemstreet".
+	FromName string `json:"fromName"`
+
+	// Subject is a text/template for the forward email's subject line.
+	// It is executed with the incomingMessage, so it can reference
+	// fields like {{.Name}}.
+	Subject string `json:"subject"`
+	// ReplySubject is a text/template for the auto-reply's subject line.
+	ReplySubject string `json:"replySubject"`
+	// ReplyTemplatePath is the HTML template used for the auto-reply body.
+	ReplyTemplatePath string `json:"replyTemplatePath"`
+
+	// SMTP optionally overrides the server-wide SMTP credentials for
+	// this form only. Leave nil to use the default.
+	SMTP *SMTPConfig `json:"smtp,omitempty"`
+}
+
+// ServerConfig is the top level of the forms config file: the list of
+// forms this binary serves.
+type ServerConfig struct {
+	Forms []FormConfig `json:"forms"`
+}
+
+// LoadServerConfig reads and parses the JSON config file at path
+// describing every form this server should serve.
+func LoadServerConfig(path string) (ServerConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ServerConfig{}, fmt.Errorf("reading forms config %s: %w", path, err)
+	}
+
+	var cfg ServerConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return ServerConfig{}, fmt.Errorf("parsing forms config %s: %w", path, err)
+	}
+
+	for i, form := range cfg.Forms {
+		if form.Path == "" {
+			return ServerConfig{}, fmt.Errorf("forms config: forms[%d] is missing path", i)
+		}
+		if form.PublicEmail == "" {
+			return ServerConfig{}, fmt.Errorf("forms config: forms[%d] (%s) is missing publicEmail", i, form.Path)
+		}
+		if form.PrivateEmail == "" {
+			return ServerConfig{}, fmt.Errorf("forms config: forms[%d] (%s) is missing privateEmail", i, form.Path)
+		}
+		if form.ReplyTemplatePath == "" {
+			return ServerConfig{}, fmt.Errorf("forms config: forms[%d] (%s) is missing replyTemplatePath", i, form.Path)
+		}
+	}
+
+	return cfg, nil
+}
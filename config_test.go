@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeConfigFile(t *testing.T, cfg ServerConfig) string {
+	t.Helper()
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatalf("marshaling test config: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "forms.json")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("writing test config: %v", err)
+	}
+	return path
+}
+
+func TestLoadServerConfig(t *testing.T) {
+	path := writeConfigFile(t, ServerConfig{
+		Forms: []FormConfig{
+			{
+				Path:              "/api/v1/contactFormEmail",
+				AllowedOrigins:    []string{"https://example.com"},
+				PublicEmail:       "me@example.com",
+				PrivateEmail:      "private@example.com",
+				FromName:          "Example Co",
+				ReplyTemplatePath: "htmlTemplates/thankYouEmail.html",
+			},
+		},
+	})
+
+	cfg, err := LoadServerConfig(path)
+	if err != nil {
+		t.Fatalf("unexpected error loading config: %v", err)
+	}
+	if len(cfg.Forms) != 1 || cfg.Forms[0].PublicEmail != "me@example.com" {
+		t.Fatalf("unexpected parsed config: %+v", cfg)
+	}
+}
+
+func TestLoadServerConfigRejectsMissingFields(t *testing.T) {
+	path := writeConfigFile(t, ServerConfig{
+		Forms: []FormConfig{{Path: "/api/v1/contactFormEmail"}},
+	})
+
+	if _, err := LoadServerConfig(path); err == nil {
+		t.Fatal("expected an error for a form missing required fields")
+	}
+}
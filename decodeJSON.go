@@ -19,15 +19,16 @@ func (mr *malformedRequest) Error() string {
 }
 
 // decodeJSONBody decodes the JSON in the body of the request,
-// and makes sure it is of decoderStructType.
-func decodeJSONBody(w http.ResponseWriter, r *http.Request, decoderStructType interface{}) error {
+// and makes sure it is of decoderStructType. maxBytes caps the size of
+// the request body; decoding a body larger than that stops once the
+// limit is read past and the request is rejected with 413.
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, decoderStructType interface{}, maxBytes int64) error {
 	if r.Header.Get("Content-Type") != "application/json" {
 		msg := "Content Type header is not application/json"
 		return &malformedRequest{status: http.StatusUnsupportedMediaType, msg: msg}
 	}
 
-	// 1MB max on body of request
-	r.Body = http.MaxBytesReader(w, r.Body, 1048576)
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
 
 	decoder := json.NewDecoder(r.Body)
 	decoder.DisallowUnknownFields()
@@ -60,7 +61,7 @@ func decodeJSONBody(w http.ResponseWriter, r *http.Request, decoderStructType in
 			return &malformedRequest{status: http.StatusBadRequest, msg: msg}
 
 		case err.Error() == "http: request body too large":
-			msg := "Request body too large, must be no larger than 1MB"
+			msg := fmt.Sprintf("Request body too large, must be no larger than %d bytes", maxBytes)
 			return &malformedRequest{status: http.StatusRequestEntityTooLarge, msg: msg}
 
 		default:
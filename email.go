@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"log"
+	"mime/multipart"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	texttemplate "text/template"
+)
+
+// forwardPersonalName is the display name used on the To header of the
+// forward email, since the private mailbox doesn't have its own
+// FormConfig-level name.
+const forwardPersonalName = "Private"
+
+// defaultSubjectTemplate and defaultReplySubjectTemplate are used when a
+// FormConfig doesn't set Subject/ReplySubject.
+const (
+	defaultSubjectTemplate      = "Important: Contact Form Submission from {{.Name}}"
+	defaultReplySubjectTemplate = "You Contacted {{.FromName}}"
+)
+
+// emailTemplateData is what subject templates are executed against: the
+// submitted fields plus the form's configured display name.
+type emailTemplateData struct {
+	incomingMessage
+	FromName string
+}
+
+// formatAddress renders name/address as an RFC 5322 address, RFC 2047
+// encoding the display name when it contains non-ASCII characters.
+func formatAddress(name, address string) string {
+	return (&mail.Address{Name: name, Address: address}).String()
+}
+
+// writeHeaders writes headers in order, one per CRLF-terminated line,
+// followed by the blank line that separates headers from the body.
+func writeHeaders(buf *bytes.Buffer, headers [][2]string) {
+	for _, h := range headers {
+		fmt.Fprintf(buf, "%s: %s\r\n", h[0], h[1])
+	}
+	buf.WriteString("\r\n")
+}
+
+// renderSubject executes tmplText (falling back to fallback if empty or
+// unparsable) against data, returning the fallback literally if even
+// that fails to execute. The result always has \r and \n stripped: a
+// template can reference any field on data, including Body, which is
+// allowed to contain raw newlines, and this result is written straight
+// into a header line.
+func renderSubject(tmplText, fallback string, data emailTemplateData) string {
+	if tmplText == "" {
+		tmplText = fallback
+	}
+	t, err := texttemplate.New("subject").Parse(tmplText)
+	if err != nil {
+		log.Println("Error parsing subject template, using fallback", err)
+		t = texttemplate.Must(texttemplate.New("subject").Parse(fallback))
+	}
+	buf := new(bytes.Buffer)
+	if err := t.Execute(buf, data); err != nil {
+		log.Println("Error executing subject template, using fallback", err)
+		return stripHeaderBreaks(fallback)
+	}
+	return stripHeaderBreaks(buf.String())
+}
+
+// stripHeaderBreaks removes carriage returns and line feeds from s, so
+// it's always safe to use as a single header value.
+func stripHeaderBreaks(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
+
+// makeReplyEmail creates a multipart/alternative (plain text and HTML)
+// email to send to whoever submitted cfg's form, thanking them and
+// letting them know the message got through. replyTemplate is cfg's
+// parsed ReplyTemplatePath.
+func makeReplyEmail(cfg FormConfig, replyTemplate *template.Template, inMsg incomingMessage) string {
+	data := emailTemplateData{incomingMessage: inMsg, FromName: cfg.FromName}
+
+	// Create HTML message to send in reply.
+	// If this fails the email will be plain text only.
+	htmlBuf := new(bytes.Buffer)
+	err := replyTemplate.Execute(htmlBuf, data)
+	useHTML := err == nil
+	if !useHTML {
+		log.Println("Error executing reply email template", err)
+	}
+
+	subject := renderSubject(cfg.ReplySubject, defaultReplySubjectTemplate, data)
+
+	buf := new(bytes.Buffer)
+	writer := multipart.NewWriter(buf)
+
+	writeHeaders(buf, [][2]string{
+		{"From", formatAddress(cfg.FromName, cfg.PublicEmail)},
+		{"To", formatAddress(inMsg.Name, inMsg.Email)},
+		{"Subject", subject},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", fmt.Sprintf("multipart/alternative; boundary=%q", writer.Boundary())},
+	})
+
+	plainText := fmt.Sprintf("Hi %s,\n\nThank you for contacting me! I will get back to you soon.\n\nSincerely,\n%s\n", inMsg.Name, cfg.FromName)
+	textPart, err := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {"text/plain; charset=utf-8"},
+	})
+	if err == nil {
+		textPart.Write([]byte(plainText))
+	}
+
+	if useHTML {
+		htmlPart, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type": {"text/html; charset=utf-8"},
+		})
+		if err == nil {
+			htmlPart.Write(htmlBuf.Bytes())
+		}
+	}
+
+	writer.Close()
+
+	return buf.String()
+}
+
+// makeForwardEmail creates an email with details about the message
+// received from cfg's form. When inMsg carries attachments they are
+// included here (never in the auto-reply) as a multipart/mixed envelope
+// wrapping the plain text body.
+func makeForwardEmail(cfg FormConfig, inMsg incomingMessage) string {
+	data := emailTemplateData{incomingMessage: inMsg, FromName: cfg.FromName}
+
+	body := fmt.Sprintf("%s at %s sent the following:\n\n%s\n\n%s\n\n", inMsg.Name, inMsg.Email, inMsg.Title, inMsg.Body)
+	subject := renderSubject(cfg.Subject, defaultSubjectTemplate, data)
+
+	from := formatAddress(cfg.FromName, cfg.PublicEmail)
+	to := formatAddress(forwardPersonalName, cfg.PrivateEmail)
+
+	if len(inMsg.Attachments) == 0 {
+		buf := new(bytes.Buffer)
+		writeHeaders(buf, [][2]string{
+			{"From", from},
+			{"To", to},
+			{"Subject", subject},
+			{"MIME-Version", "1.0"},
+			{"Content-Type", "text/plain; charset=utf-8"},
+		})
+		buf.WriteString(body)
+		return buf.String()
+	}
+
+	buf := new(bytes.Buffer)
+	writer := multipart.NewWriter(buf)
+
+	writeHeaders(buf, [][2]string{
+		{"From", from},
+		{"To", to},
+		{"Subject", subject},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", fmt.Sprintf("multipart/mixed; boundary=%q", writer.Boundary())},
+	})
+
+	textPart, err := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {"text/plain; charset=utf-8"},
+	})
+	if err == nil {
+		textPart.Write([]byte(body))
+	}
+
+	for _, a := range inMsg.Attachments {
+		part, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {a.ContentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {fmt.Sprintf("attachment; filename=%q", a.Filename)},
+		})
+		if err != nil {
+			log.Println("Error creating attachment part", err)
+			continue
+		}
+		// a.Data is already base64, matching the Content-Transfer-Encoding above.
+		part.Write([]byte(a.Data))
+	}
+
+	writer.Close()
+
+	return buf.String()
+}
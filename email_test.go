@@ -0,0 +1,123 @@
+package main
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+func TestEmailHeaders(t *testing.T) {
+	inMsg := incomingMessage{
+		Name:  "Adä Lovelace",
+		Email: "ada@example.com",
+		Title: "Hello",
+		Body:  "Just saying hi.",
+	}
+	cfg := FormConfig{
+		PublicEmail:  "public@example.com",
+		PrivateEmail: "private@example.com",
+		FromName:     "Test Sender",
+	}
+
+	raw := makeForwardEmail(cfg, inMsg)
+
+	msg, err := mail.ReadMessage(strings.NewReader(raw))
+	if err != nil {
+		t.Fatalf("produced message did not parse: %v", err)
+	}
+
+	from, err := msg.Header.AddressList("From")
+	if err != nil || len(from) != 1 || from[0].Address != "public@example.com" {
+		t.Fatalf("unexpected From header: %v, err: %v", from, err)
+	}
+
+	to, err := msg.Header.AddressList("To")
+	if err != nil || len(to) != 1 || to[0].Address != "private@example.com" {
+		t.Fatalf("unexpected To header: %v, err: %v", to, err)
+	}
+
+	subject := msg.Header.Get("Subject")
+	if !strings.Contains(subject, "Adä Lovelace") {
+		t.Fatalf("expected subject to contain sender name, got %q", subject)
+	}
+
+	body, err := io.ReadAll(msg.Body)
+	if err != nil {
+		t.Fatalf("reading body: %v", err)
+	}
+	if !strings.Contains(string(body), inMsg.Body) {
+		t.Fatalf("expected forwarded body to contain message text, got %q", body)
+	}
+}
+
+func TestMakeForwardEmailSubjectTemplateCannotInjectHeaders(t *testing.T) {
+	inMsg := incomingMessage{
+		Name:  "Ada Lovelace",
+		Email: "ada@example.com",
+		Title: "Hello",
+		Body:  "Line one\r\nX-Injected: evil\nLine three",
+	}
+	cfg := FormConfig{
+		PublicEmail:  "public@example.com",
+		PrivateEmail: "private@example.com",
+		FromName:     "Test Sender",
+		Subject:      "New message: {{.Body}}",
+	}
+
+	raw := makeForwardEmail(cfg, inMsg)
+
+	msg, err := mail.ReadMessage(strings.NewReader(raw))
+	if err != nil {
+		t.Fatalf("produced message did not parse: %v", err)
+	}
+	if msg.Header.Get("X-Injected") != "" {
+		t.Fatalf("subject template referencing Body injected a header: %q", msg.Header.Get("X-Injected"))
+	}
+}
+
+func TestReplyEmailHasAlternativeParts(t *testing.T) {
+	inMsg := incomingMessage{
+		Name:  "Grace Hopper",
+		Email: "grace@example.com",
+		Title: "Hi",
+		Body:  "Hello there",
+	}
+	cfg, replyTemplate := testFormConfig(t)
+
+	raw := makeReplyEmail(cfg, replyTemplate, inMsg)
+
+	msg, err := mail.ReadMessage(strings.NewReader(raw))
+	if err != nil {
+		t.Fatalf("produced message did not parse: %v", err)
+	}
+
+	to, err := msg.Header.AddressList("To")
+	if err != nil || len(to) != 1 || to[0].Address != "grace@example.com" {
+		t.Fatalf("unexpected To header: %v, err: %v", to, err)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/alternative") {
+		t.Fatalf("expected multipart/alternative, got %q (err %v)", mediaType, err)
+	}
+
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	var contentTypes []string
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("reading part: %v", err)
+		}
+		contentTypes = append(contentTypes, part.Header.Get("Content-Type"))
+	}
+
+	if len(contentTypes) != 2 {
+		t.Fatalf("expected 2 alternative parts (text + html), got %d: %v", len(contentTypes), contentTypes)
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net/smtp"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// Mailer sends a raw RFC 5322 message from fromAddr to the given
+// recipients. Implementations may reuse a single underlying connection
+// across multiple calls, so callers should not assume each Send dials a
+// fresh connection.
+type Mailer interface {
+	Send(from string, to []string, msg []byte) error
+}
+
+// smtpTLSMode controls how SMTPMailer establishes transport security.
+type smtpTLSMode string
+
+const (
+	// smtpTLSImplicit dials straight into TLS, as required by port 465.
+	smtpTLSImplicit smtpTLSMode = "implicit"
+	// smtpTLSStartTLS dials plain text then upgrades with STARTTLS, as
+	// used by port 587.
+	smtpTLSStartTLS smtpTLSMode = "starttls"
+	// smtpTLSNone sends over an unencrypted connection. Only useful for
+	// talking to a mail relay on localhost.
+	smtpTLSNone smtpTLSMode = "none"
+)
+
+// SMTPConfig holds everything needed to connect to an SMTP server.
+// It is read from env vars by SMTPConfigFromEnv so that self-hosted
+// relays (Postal, Postfix, mailgun-relay) and TLS-only providers can be
+// used without recompiling.
+type SMTPConfig struct {
+	Host               string
+	Port               string
+	Username           string
+	Password           string
+	TLSMode            smtpTLSMode
+	InsecureSkipVerify bool
+}
+
+// Addr returns the "host:port" string smtp.Dial/tls.Dial expect.
+func (c SMTPConfig) Addr() string {
+	return fmt.Sprintf("%s:%s", c.Host, c.Port)
+}
+
+// SMTPConfigFromEnv builds an SMTPConfig from SMTP_HOST, SMTP_PORT,
+// SMTP_USERNAME, SMTP_PASSWORD, SMTP_TLS_MODE ("implicit", "starttls", or
+// "none") and SMTP_INSECURE_SKIP_VERIFY ("true"/"false"). SMTP_HOST and
+// SMTP_PORT are required. SMTP_TLS_MODE defaults to "starttls", or
+// "implicit" automatically when SMTP_PORT is "465".
+func SMTPConfigFromEnv() (SMTPConfig, error) {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		return SMTPConfig{}, fmt.Errorf("SMTP_HOST env variable not set")
+	}
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		return SMTPConfig{}, fmt.Errorf("SMTP_PORT env variable not set")
+	}
+
+	mode := smtpTLSMode(os.Getenv("SMTP_TLS_MODE"))
+	if mode == "" {
+		if port == "465" {
+			mode = smtpTLSImplicit
+		} else {
+			mode = smtpTLSStartTLS
+		}
+	}
+	if mode != smtpTLSImplicit && mode != smtpTLSStartTLS && mode != smtpTLSNone {
+		return SMTPConfig{}, fmt.Errorf("SMTP_TLS_MODE must be one of implicit, starttls, none")
+	}
+
+	insecure := false
+	if v := os.Getenv("SMTP_INSECURE_SKIP_VERIFY"); v != "" {
+		parsed, err := strconv.ParseBool(v)
+		if err != nil {
+			return SMTPConfig{}, fmt.Errorf("SMTP_INSECURE_SKIP_VERIFY must be a bool: %w", err)
+		}
+		insecure = parsed
+	}
+
+	return SMTPConfig{
+		Host:               host,
+		Port:               port,
+		Username:           os.Getenv("SMTP_USERNAME"),
+		Password:           os.Getenv("SMTP_PASSWORD"),
+		TLSMode:            mode,
+		InsecureSkipVerify: insecure,
+	}, nil
+}
+
+// SMTPMailer is the default Mailer. It dials cfg.Addr() and keeps the
+// connection open across calls to Send, so the reply+forward pair sent
+// by MailQueue for a single submission share one connection instead of
+// each paying for a fresh TLS handshake.
+type SMTPMailer struct {
+	cfg SMTPConfig
+
+	mu     sync.Mutex
+	client *smtp.Client
+}
+
+// NewSMTPMailer returns a Mailer that talks to cfg.Addr() using cfg's
+// TLS mode and credentials.
+func NewSMTPMailer(cfg SMTPConfig) *SMTPMailer {
+	return &SMTPMailer{cfg: cfg}
+}
+
+// Send delivers msg from from to every address in to, reusing the
+// existing connection when one is already open and healthy.
+func (m *SMTPMailer) Send(from string, to []string, msg []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	client, err := m.connection()
+	if err != nil {
+		return err
+	}
+
+	if err := m.deliver(client, from, to, msg); err != nil {
+		// The connection may be in a bad state (e.g. the server hung up).
+		// Close it so the next Send dials fresh instead of reusing
+		// something broken.
+		client.Close()
+		m.client = nil
+		return err
+	}
+
+	return nil
+}
+
+// connection returns a live *smtp.Client, dialing and authenticating a
+// new one if there isn't one open already.
+func (m *SMTPMailer) connection() (*smtp.Client, error) {
+	if m.client != nil {
+		if err := m.client.Noop(); err == nil {
+			return m.client, nil
+		}
+		m.client.Close()
+		m.client = nil
+	}
+
+	client, err := m.dial()
+	if err != nil {
+		return nil, fmt.Errorf("smtp: dial %s: %w", m.cfg.Addr(), err)
+	}
+
+	if m.cfg.Username != "" {
+		auth := smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)
+		if err := client.Auth(auth); err != nil {
+			client.Close()
+			return nil, fmt.Errorf("smtp: auth: %w", err)
+		}
+	}
+
+	m.client = client
+	return client, nil
+}
+
+// dial opens the transport-level connection to the configured server,
+// per cfg.TLSMode.
+func (m *SMTPMailer) dial() (*smtp.Client, error) {
+	switch m.cfg.TLSMode {
+	case smtpTLSImplicit:
+		conn, err := tls.Dial("tcp", m.cfg.Addr(), &tls.Config{
+			ServerName:         m.cfg.Host,
+			InsecureSkipVerify: m.cfg.InsecureSkipVerify,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return smtp.NewClient(conn, m.cfg.Host)
+
+	case smtpTLSStartTLS:
+		client, err := smtp.Dial(m.cfg.Addr())
+		if err != nil {
+			return nil, err
+		}
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			err := client.StartTLS(&tls.Config{
+				ServerName:         m.cfg.Host,
+				InsecureSkipVerify: m.cfg.InsecureSkipVerify,
+			})
+			if err != nil {
+				client.Close()
+				return nil, err
+			}
+		} else {
+			log.Println("smtp: server does not support STARTTLS, continuing without it")
+		}
+		return client, nil
+
+	default: // smtpTLSNone
+		return smtp.Dial(m.cfg.Addr())
+	}
+}
+
+// deliver runs the MAIL/RCPT/DATA sequence for a single message over an
+// already-open client, resetting the session afterwards so it is ready
+// for the next Send.
+func (m *SMTPMailer) deliver(client *smtp.Client, from string, to []string, msg []byte) error {
+	if err := client.Mail(from); err != nil {
+		return fmt.Errorf("smtp: MAIL FROM: %w", err)
+	}
+	for _, addr := range to {
+		if err := client.Rcpt(addr); err != nil {
+			return fmt.Errorf("smtp: RCPT TO %s: %w", addr, err)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("smtp: DATA: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		w.Close()
+		return fmt.Errorf("smtp: writing message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("smtp: closing DATA: %w", err)
+	}
+
+	return client.Reset()
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testFormConfig returns a minimal FormConfig plus its parsed reply
+// template, suitable for exercising newFormHandler in tests.
+func testFormConfig(t *testing.T) (FormConfig, *template.Template) {
+	t.Helper()
+	templatePath := filepath.Join(t.TempDir(), "reply.html")
+	if err := os.WriteFile(templatePath, []byte("<p>Hi {{.Name}}</p>"), 0644); err != nil {
+		t.Fatalf("writing test reply template: %v", err)
+	}
+
+	cfg := FormConfig{
+		Path:              "/api/v1/contactFormEmail",
+		AllowedOrigins:    []string{"*"},
+		PublicEmail:       "me@example.com",
+		PrivateEmail:      "private@example.com",
+		FromName:          "Test Sender",
+		ReplyTemplatePath: templatePath,
+	}
+	return cfg, template.Must(template.ParseFiles(templatePath))
+}
+
+// fakeSmtp is a Mailer used in tests so no real SMTP server is needed.
+type fakeSmtp struct {
+	mu   sync.Mutex
+	sent []sentMessage
+	err  error
+}
+
+type sentMessage struct {
+	from string
+	to   []string
+	msg  []byte
+}
+
+func (f *fakeSmtp) Send(from string, to []string, msg []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sent = append(f.sent, sentMessage{from: from, to: to, msg: msg})
+	return f.err
+}
+
+func (f *fakeSmtp) sentMessages() []sentMessage {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]sentMessage(nil), f.sent...)
+}
+
+func TestMailHandlerSendsReplyAndForward(t *testing.T) {
+	cfg, replyTemplate := testFormConfig(t)
+
+	mailer := &fakeSmtp{}
+	queue := NewMailQueue(mailer, 1, 10, "")
+	attachmentCfg, err := attachmentConfigFromEnv()
+	if err != nil {
+		t.Fatalf("unexpected error building attachment config: %v", err)
+	}
+	handler := newFormHandler(cfg, replyTemplate, queue, AbuseConfig{HoneypotEnabled: true}, attachmentCfg)
+
+	body := strings.NewReader(`{"Name":"Ada","Email":"ada@example.com","Title":"Hi","Body":"Hello there"}`)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/contactFormEmail", body)
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	handler(rec, req)
+
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected status 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	sent := waitForSentCount(t, mailer, 2)
+	if sent[0].to[0] != "ada@example.com" {
+		t.Errorf("expected reply to go to ada@example.com, got %s", sent[0].to[0])
+	}
+	if sent[1].to[0] != "private@example.com" {
+		t.Errorf("expected forward to go to private@example.com, got %s", sent[1].to[0])
+	}
+}
+
+func waitForSentCount(t *testing.T, mailer *fakeSmtp, n int) []sentMessage {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if sent := mailer.sentMessages(); len(sent) >= n {
+			return sent
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d messages to be sent", n)
+	return nil
+}
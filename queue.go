@@ -0,0 +1,248 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/textproto"
+	"os"
+	"sync"
+	"time"
+)
+
+// jobStatus is the lifecycle state of a mailJob, as reported by the
+// /api/v1/status/{id} endpoint.
+type jobStatus string
+
+const (
+	statusQueued jobStatus = "queued"
+	statusSent   jobStatus = "sent"
+	statusFailed jobStatus = "failed"
+)
+
+// sendBackoff is how long to wait before each retry of a failed,
+// transient send. Three retries, at 5s/30s/2m.
+var sendBackoff = []time.Duration{5 * time.Second, 30 * time.Second, 2 * time.Minute}
+
+// mailJob is one contact form submission's reply+forward pair, queued
+// for background delivery.
+type mailJob struct {
+	ID string
+
+	InMsg      incomingMessage
+	ReplyFrom  string
+	ReplyTo    string
+	ReplyMsg   []byte
+	ForwardTo  string
+	ForwardMsg []byte
+}
+
+// MailQueue is a bounded worker pool that delivers mailJobs in the
+// background so newFormHandler never blocks the HTTP response on an SMTP
+// round trip. Jobs that fail after all retries are exhausted are
+// appended to a dead-letter file instead of being silently dropped.
+type MailQueue struct {
+	mailer Mailer
+
+	jobs chan *mailJob
+
+	mu       sync.Mutex
+	statuses map[string]jobStatus
+
+	deadLetterPath string
+}
+
+// NewMailQueue creates a queue backed by mailer, with workerCount
+// background workers each able to hold one in-flight job, and queueSize
+// jobs buffered before Enqueue starts rejecting submissions. Jobs that
+// exhaust retries are appended as JSON to deadLetterPath (if non-empty).
+func NewMailQueue(mailer Mailer, workerCount int, queueSize int, deadLetterPath string) *MailQueue {
+	q := &MailQueue{
+		mailer:         mailer,
+		jobs:           make(chan *mailJob, queueSize),
+		statuses:       make(map[string]jobStatus),
+		deadLetterPath: deadLetterPath,
+	}
+	for i := 0; i < workerCount; i++ {
+		go q.worker()
+	}
+	return q
+}
+
+// Enqueue assigns a job ID, records it as queued, and hands the job to
+// a worker. It returns an error if the queue is full.
+func (q *MailQueue) Enqueue(job *mailJob) (string, error) {
+	id, err := newJobID()
+	if err != nil {
+		return "", err
+	}
+	job.ID = id
+
+	q.setStatus(id, statusQueued)
+
+	select {
+	case q.jobs <- job:
+		return id, nil
+	default:
+		q.setStatus(id, statusFailed)
+		return "", errors.New("mail queue is full")
+	}
+}
+
+// Status returns the current state of a job, and whether that job ID is
+// known at all.
+func (q *MailQueue) Status(id string) (jobStatus, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	s, ok := q.statuses[id]
+	return s, ok
+}
+
+// statusSource is anything that can answer "what's the status of job
+// id": just *MailQueue in practice, kept as an interface so
+// multiQueueStatus can be tested without a real queue.
+type statusSource interface {
+	Status(id string) (jobStatus, bool)
+}
+
+// multiQueueStatus looks a job id up across every form's queue, since
+// each FormConfig gets its own MailQueue.
+type multiQueueStatus struct {
+	queues []statusSource
+}
+
+func (m multiQueueStatus) Status(id string) (jobStatus, bool) {
+	for _, q := range m.queues {
+		if s, ok := q.Status(id); ok {
+			return s, true
+		}
+	}
+	return "", false
+}
+
+func (q *MailQueue) setStatus(id string, s jobStatus) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.statuses[id] = s
+}
+
+// worker pulls jobs off the channel and delivers them one at a time.
+func (q *MailQueue) worker() {
+	for job := range q.jobs {
+		q.deliver(job)
+	}
+}
+
+// deliver sends both the reply and the forward email, retrying each
+// independently on transient failure, and dead-lettering the job if
+// either one never gets through.
+func (q *MailQueue) deliver(job *mailJob) {
+	replyErr := q.sendWithRetry(job.ReplyFrom, []string{job.ReplyTo}, job.ReplyMsg)
+	forwardErr := q.sendWithRetry(job.ReplyFrom, []string{job.ForwardTo}, job.ForwardMsg)
+
+	if replyErr != nil || forwardErr != nil {
+		q.deadLetter(job, errors.Join(replyErr, forwardErr))
+		q.setStatus(job.ID, statusFailed)
+		return
+	}
+
+	q.setStatus(job.ID, statusSent)
+}
+
+// sendWithRetry sends msg, retrying on transient errors per
+// sendBackoff. A permanent SMTP error (5xx) is not retried.
+func (q *MailQueue) sendWithRetry(from string, to []string, msg []byte) error {
+	var lastErr error
+	for attempt := 0; ; attempt++ {
+		err := q.mailer.Send(from, to, msg)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+
+		if isPermanentSendError(err) {
+			return lastErr
+		}
+		if attempt >= len(sendBackoff) {
+			return lastErr
+		}
+		time.Sleep(sendBackoff[attempt])
+	}
+}
+
+// isPermanentSendError reports whether err is an SMTP 5xx response,
+// which retrying will not fix. Everything else (4xx, network errors) is
+// treated as transient.
+func isPermanentSendError(err error) bool {
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) {
+		return protoErr.Code >= 500 && protoErr.Code < 600
+	}
+	return false
+}
+
+// deadLetterEntry is the JSON shape appended to the dead-letter file.
+type deadLetterEntry struct {
+	JobID   string          `json:"jobId"`
+	Message incomingMessage `json:"message"`
+	Error   string          `json:"error"`
+}
+
+// deadLetter appends job and cause to q.deadLetterPath so the
+// submission isn't silently lost. If deadLetterPath is unset this only
+// logs.
+func (q *MailQueue) deadLetter(job *mailJob, cause error) {
+	log.Printf("Mail job %s failed permanently: %v", job.ID, cause)
+
+	if q.deadLetterPath == "" {
+		return
+	}
+
+	entry := deadLetterEntry{JobID: job.ID, Message: job.InMsg, Error: cause.Error()}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		log.Println("Error marshaling dead-letter entry", err)
+		return
+	}
+
+	f, err := os.OpenFile(q.deadLetterPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Println("Error opening dead-letter file", err)
+		return
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		log.Println("Error writing dead-letter entry", err)
+	}
+}
+
+// mailQueueWorkerCount reads MAIL_QUEUE_WORKERS, defaulting to 2.
+func mailQueueWorkerCount() int {
+	n, err := intEnvOrDefault("MAIL_QUEUE_WORKERS", 2)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return int(n)
+}
+
+// mailQueueSize reads MAIL_QUEUE_SIZE, defaulting to 100.
+func mailQueueSize() int {
+	n, err := intEnvOrDefault("MAIL_QUEUE_SIZE", 100)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return int(n)
+}
+
+// newJobID returns a random hex identifier for a mailJob.
+func newJobID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generating job id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// permanentFailMailer always fails with a permanent (5xx) SMTP error.
+type permanentFailMailer struct{ attempts int }
+
+func (m *permanentFailMailer) Send(from string, to []string, msg []byte) error {
+	m.attempts++
+	return &textproto.Error{Code: 550, Msg: "mailbox unavailable"}
+}
+
+func TestMailQueueDeadLettersPermanentFailures(t *testing.T) {
+	mailer := &permanentFailMailer{}
+	deadLetterPath := filepath.Join(t.TempDir(), "dead-letters.jsonl")
+	queue := NewMailQueue(mailer, 1, 10, deadLetterPath)
+
+	job := &mailJob{
+		InMsg:      incomingMessage{Name: "Ada", Email: "ada@example.com"},
+		ReplyFrom:  "me@example.com",
+		ReplyTo:    "ada@example.com",
+		ReplyMsg:   []byte("reply"),
+		ForwardTo:  "private@example.com",
+		ForwardMsg: []byte("forward"),
+	}
+
+	id, err := queue.Enqueue(job)
+	if err != nil {
+		t.Fatalf("unexpected enqueue error: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	var status jobStatus
+	for time.Now().Before(deadline) {
+		s, ok := queue.Status(id)
+		if ok && s == statusFailed {
+			status = s
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if status != statusFailed {
+		t.Fatalf("expected job to end up failed, got %q", status)
+	}
+
+	// A permanent error must not be retried.
+	if mailer.attempts != 2 {
+		t.Errorf("expected exactly 2 attempts (reply + forward, no retries), got %d", mailer.attempts)
+	}
+
+	data, err := os.ReadFile(deadLetterPath)
+	if err != nil {
+		t.Fatalf("expected dead-letter file to be written: %v", err)
+	}
+
+	var entry deadLetterEntry
+	if err := json.Unmarshal(data[:len(data)-1], &entry); err != nil {
+		t.Fatalf("dead-letter entry did not parse as JSON: %v", err)
+	}
+	if entry.JobID != id {
+		t.Errorf("expected dead-letter entry for job %s, got %s", id, entry.JobID)
+	}
+}
+
+func TestIsPermanentSendError(t *testing.T) {
+	if !isPermanentSendError(&textproto.Error{Code: 550}) {
+		t.Error("expected 5xx to be permanent")
+	}
+	if isPermanentSendError(&textproto.Error{Code: 421}) {
+		t.Error("expected 4xx to be transient")
+	}
+	if isPermanentSendError(errors.New("connection reset")) {
+		t.Error("expected a plain network error to be transient")
+	}
+}
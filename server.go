@@ -3,7 +3,6 @@
 package main
 
 import (
-	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -11,10 +10,8 @@ import (
 	"html/template"
 	"log"
 	"net/http"
-	"net/smtp"
 	"os"
 	"strings"
-	"regexp"
 )
 
 // incomingMessage defines the structure of the message sent in the request body
@@ -23,211 +20,209 @@ type incomingMessage struct {
 	Email string
 	Title string
 	Body  string
+	// Attachments is optional. Each entry's Data is base64 encoded and
+	// is only ever relayed on the forward email, never the auto-reply.
+	Attachments []attachment `json:",omitempty"`
+	// CaptchaToken is the hCaptcha/Turnstile response token, required
+	// only when captcha verification is enabled.
+	CaptchaToken string `json:",omitempty"`
+	// Website is a honeypot: it should never be filled in by a real
+	// visitor, since it's hidden on the frontend form. Bots that fill
+	// in every field trip it.
+	Website string `json:",omitempty"`
 }
 
-// These variables must compile.
-var (
-	// HTML Template for sending thank you email reply.
-	thankYouEmailTemplate = template.Must(template.ParseFiles("htmlTemplates/thankYouEmail.html"))
-	// RegExp for email and all other text fields.
-	emailRegExp = regexp.MustCompile(`^(([^<>()\[\]\\.,;:\s@"]+(\.[^<>()\[\]\\.,;:\s@"]+)*)|(".+"))@((\[[0-9]{1,3}\.[0-9]{1,3}\.[0-9]{1,3}\.[0-9]{1,3}])|(([a-zA-Z\-0-9]+\.)+[a-zA-Z]{2,}))$`)
-	textRegExp = regexp.MustCompile(`^[$!@&#%?'":,^a-z A-Z0-9_.-]*$`)
-)
-
-
 func main() {
-	// Allowed Origins for CORS, should be a comma delimited string.
-	ao := os.Getenv("ALLOWED_ORIGINS")
-	if ao == "" {
-		log.Fatal("ALLOWED_ORIGINS env variable not set")
+	configPath := os.Getenv("FORMS_CONFIG_PATH")
+	if configPath == "" {
+		log.Fatal("FORMS_CONFIG_PATH env variable not set")
+	}
+	serverConfig, err := LoadServerConfig(configPath)
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	allowedOrigins := strings.Split(ao, ",")
 	port := os.Getenv("PORT")
 	if port == "" {
 		log.Fatal("PORT env variable not set")
 	}
 
-	mux := http.NewServeMux()
-	mux.HandleFunc("/api/v1/contactFormEmail", handleMail)
-
-	handler := cors.New(cors.Options{
-		AllowedOrigins:   allowedOrigins,
-		AllowCredentials: true,
-		AllowedMethods:   []string{"POST", "post"},
-		Debug:            false,
-	}).Handler(mux)
-
-	log.Fatal(http.ListenAndServe(":" + port, handler))
-}
-
-// handleMail sends a reply email to whoever sent me a message from my website,
-// and also forwards the message they sent to my private email.
-func handleMail(w http.ResponseWriter, r *http.Request) {
-
-	// publicEmail is the email I am using to send emails.
-	// publicEmailPassword is used to set up the Auth for smtp.SendMail.
-	// privateEmail is the email I forward the inMsg to.
-	publicEmail := os.Getenv("PUBLIC_EMAIL")
-	publicEmailPassword := os.Getenv("PUBLIC_EMAIL_PASSWORD")
-	privateEmail := os.Getenv("PRIVATE_EMAIL")
-	if privateEmail == "" {
-		log.Fatalln("Env variable PRIVATE_EMAIL is not set.")
-	}
-	if publicEmail == "" {
-		log.Fatalln("Env variable PUBLIC_EMAIL is not set.")
-	}
-	if publicEmailPassword == "" {
-		log.Fatalln("Env variable PUBLIC_EMAIL_PASSWORD is not set.")
+	defaultSMTPConfig, err := SMTPConfigFromEnv()
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	// I need to get the incoming message from the request body.
-	// This decodeJSON func insures the message is valid.
-	var inMsg incomingMessage
-	err := decodeJSONBody(w, r, &inMsg)
+	abuseCfg, err := AbuseConfigFromEnv()
 	if err != nil {
-		var malReq *malformedRequest
-		if errors.As(err, &malReq) {
-			http.Error(w, malReq.msg, malReq.status)
-		} else {
-			log.Println(err.Error())
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		}
-		return
+		log.Fatal(err)
 	}
 
-	if !validateIncomingMessage(w, inMsg) {
-		return
+	attachmentCfg, err := attachmentConfigFromEnv()
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	// Make messages that are going to be emailed.
-	replyMsg := makeReplyEmail(inMsg, publicEmail)
-	forwardMsg := makeForwardEmail(inMsg, privateEmail, publicEmail)
+	workerCount := mailQueueWorkerCount()
+	queueSize := mailQueueSize()
+	deadLetterPath := os.Getenv("DEAD_LETTER_PATH")
+
+	mux := http.NewServeMux()
+	var queues []statusSource
 
-	// Auth and address for smtp service, I am using gmail.
-	auth := smtp.PlainAuth("", publicEmail, publicEmailPassword, "smtp.gmail.com")
-	addr := "smtp.gmail.com:587"
+	for _, form := range serverConfig.Forms {
+		replyTemplate := template.Must(template.ParseFiles(form.ReplyTemplatePath))
 
-	// Send messages and check for errors.
-	replyErr := smtp.SendMail(addr, auth, publicEmail, []string{inMsg.Email}, []byte(replyMsg))
-	forwardErr := smtp.SendMail(addr, auth, publicEmail, []string{privateEmail}, []byte(forwardMsg))
+		smtpConfig := defaultSMTPConfig
+		if form.SMTP != nil {
+			smtpConfig = *form.SMTP
+		}
+		mailer := NewSMTPMailer(smtpConfig)
+		queue := NewMailQueue(mailer, workerCount, queueSize, deadLetterPath)
+		queues = append(queues, queue)
 
-	// Response object that the client expects back.
-	response := struct{ Success bool }{Success: false}
+		handler := rateLimitMiddleware(abuseCfg, newFormHandler(form, replyTemplate, queue, abuseCfg, attachmentCfg))
+		corsHandler := cors.New(cors.Options{
+			AllowedOrigins:   form.AllowedOrigins,
+			AllowCredentials: true,
+			AllowedMethods:   []string{"POST", "post"},
+			Debug:            false,
+		}).Handler(handler)
 
-	if forwardErr != nil {
-		log.Printf("Forward message failed! Email: %s, Name: %s, Subject: %s, Body: %s", inMsg.Email, inMsg.Name, inMsg.Title, inMsg.Body)
-		log.Println("Forward Error: ", forwardErr)
+		mux.Handle(form.Path, corsHandler)
 	}
 
-	if replyErr != nil {
-		log.Printf("Reply message failed! Email: %s, Name: %s, Subject: %s, Body: %s", inMsg.Email, inMsg.Name, inMsg.Title, inMsg.Body)
-		log.Println("Reply Error: ", replyErr)
+	mux.HandleFunc("/api/v1/status/", newStatusHandler(multiQueueStatus{queues: queues}))
+
+	log.Fatal(http.ListenAndServe(":"+port, mux))
+}
+
+// newFormHandler builds the handler for one FormConfig: it validates a
+// contact form submission, builds a reply email to whoever sent it and
+// a forward email to cfg's private address, and enqueues both onto
+// queue for background delivery. The actual sends happen off the
+// request, so the response only reports that the job was accepted.
+// abuseCfg controls the honeypot and captcha checks; rate limiting is
+// applied as an outer middleware since it doesn't need the decoded
+// body.
+func newFormHandler(cfg FormConfig, replyTemplate *template.Template, queue *MailQueue, abuseCfg AbuseConfig, attachmentCfg attachmentConfig) http.HandlerFunc {
+	// The request body has to fit every attachment's base64 encoding,
+	// which inflates raw bytes by 4/3, plus some headroom for the rest
+	// of the JSON fields.
+	maxBodyBytes := attachmentCfg.MaxTotalBytes*4/3 + 1048576
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		// I need to get the incoming message from the request body.
+		// This decodeJSON func insures the message is valid.
+		var inMsg incomingMessage
+		err := decodeJSONBody(w, r, &inMsg, maxBodyBytes)
+		if err != nil {
+			var malReq *malformedRequest
+			if errors.As(err, &malReq) {
+				http.Error(w, malReq.msg, malReq.status)
+			} else {
+				log.Println(err.Error())
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		if fieldErrs := validateIncomingMessage(inMsg); len(fieldErrs) > 0 {
+			writeValidationErrors(w, fieldErrs)
+			return
+		}
+
+		if abuseCfg.HoneypotEnabled && inMsg.Website != "" {
+			http.Error(w, "Request body contains an inappropriate value.", http.StatusBadRequest)
+			return
+		}
+
+		if abuseCfg.CaptchaEnabled {
+			ok, err := verifyCaptcha(abuseCfg, inMsg.CaptchaToken, clientIP(r, abuseCfg))
+			if err != nil {
+				log.Println("Error verifying captcha: ", err)
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			if !ok {
+				http.Error(w, "Captcha verification failed.", http.StatusForbidden)
+				return
+			}
+		}
+
+		if field, reason, ok := validateAttachments(inMsg.Attachments, attachmentCfg); !ok {
+			http.Error(w, fmt.Sprintf("Attachment %s: %s", field, reason), http.StatusBadRequest)
+			return
+		}
+
+		// Make messages that are going to be emailed.
+		job := &mailJob{
+			InMsg:      inMsg,
+			ReplyFrom:  cfg.PublicEmail,
+			ReplyTo:    inMsg.Email,
+			ReplyMsg:   []byte(makeReplyEmail(cfg, replyTemplate, inMsg)),
+			ForwardTo:  cfg.PrivateEmail,
+			ForwardMsg: []byte(makeForwardEmail(cfg, inMsg)),
+		}
+
+		id, err := queue.Enqueue(job)
+		if err != nil {
+			log.Println("Error enqueueing mail job: ", err)
+			http.Error(w, "Server is too busy, try again shortly.", http.StatusServiceUnavailable)
+			return
+		}
 
-		response.Success = false
+		response := struct {
+			JobID string `json:"jobId"`
+		}{JobID: id}
 		responseJSON, err := json.Marshal(response)
-		// If we fail to make JSON send an internal service error.
 		if err != nil {
 			http.Error(w, "Error", http.StatusInternalServerError)
 			return
 		}
 		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
 		w.Write(responseJSON)
-		return
-	}
-
-	response.Success = true
-	responseJSON, err := json.Marshal(response)
-	// If we fail to make JSON just send "Success"
-	if err != nil {
-		w.Write([]byte("Success"))
-		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(responseJSON)
-}
-
-// makeReplyEmail creates an email with plain text and HTML to send
-// to whoever messaged me in the first place. It says thanks and lets them know I got there message.
-func makeReplyEmail(inMsg incomingMessage, fromEmail string) string {
-	// Create HTML message to send in reply.
-	// If this fails the email will be plain text only.
-	replyData := struct{ Name string }{Name: inMsg.Name}
-	htmlBuf := new(bytes.Buffer)
-	err := thankYouEmailTemplate.Execute(htmlBuf, replyData)
-	useHTML := err == nil
-	if !useHTML {
-		log.Println("Error parsing email template", err)
-	}
-	// Creates multipart MIME (plain text and HTML) that is very annoying and fragile.
-	// CRLF or "\r\n" is very important and should not be messed with without double checking result.
-	header := make(map[string]string)
-	header["From"] = fmt.Sprintf("Spencer Hemstreet <%s>", fromEmail)
-	header["To"] = fmt.Sprintf("%s <%s>", inMsg.Name, inMsg.Email)
-	header["Subject"] = "You Contacted Spencer Hemstreet"
-	header["MIME-Version"] = "1.0"
-	header["Content-Type"] = "multipart/alternative; boundary=\"boundary123\""
-
-	plainTextMsg := "--boundary123\nContent-Type: text/plain; charset=us-ascii\r\n"
-	plainTextMsg += fmt.Sprintf("Hi %s,\n\nThank you for contacting me! I will get back to you soon.\n\nSincerely,\nSpencer Hemstreet\n", inMsg.Name)
-
-	message := ""
-	for key, value := range header {
-		message += fmt.Sprintf("%s: %s\r\n", key, value)
-	}
-	message += plainTextMsg
-
-	if useHTML {
-		htmlMsg := "--boundary123\nContent-Type: text/html\r\n" + htmlBuf.String()
-		message += htmlMsg
-	}
-	// Insert ending boundary
-	message += "\r\n--boundary123--"
-
-	return message
 }
 
-// makeForwardEmail creates an email that is just plain text, with details about the message received from the client.
-func makeForwardEmail(inMsg incomingMessage, toEmail string, fromEmail string) string {
-	header := make(map[string]string)
-	header["From"] = fmt.Sprintf("Spencer Hemstreet <%s>", fromEmail)
-	header["To"] = fmt.Sprintf("Spencer <%s>", toEmail)
-	header["Subject"] = fmt.Sprintf("Important: Contact Form Submission from %s", inMsg.Name)
-	header["MIME-Version"] = "1.0"
-	header["Content-Type"] = "text/plain; charset=\"utf-8\""
+// newStatusHandler builds the handler behind /api/v1/status/{id}, which
+// reports whether a previously enqueued mail job is queued, sent, or
+// failed. source is checked across every form's queue.
+func newStatusHandler(source statusSource) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/api/v1/status/")
+		if id == "" {
+			http.Error(w, "Missing job id", http.StatusBadRequest)
+			return
+		}
 
-	body := fmt.Sprintf("\r\n%s at %s sent the following:\n\n%s\n\n%s\n\n", inMsg.Name, inMsg.Email, inMsg.Title, inMsg.Body)
+		status, ok := source.Status(id)
+		if !ok {
+			http.Error(w, "Unknown job id", http.StatusNotFound)
+			return
+		}
 
-	message := ""
-	for key, value := range header {
-		message += fmt.Sprintf("%s: %s\r\n", key, value)
+		response := struct {
+			Status jobStatus `json:"status"`
+		}{Status: status}
+		responseJSON, err := json.Marshal(response)
+		if err != nil {
+			http.Error(w, "Error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(responseJSON)
 	}
-	message += body
-
-	return message
 }
 
-// validateIncomingMessage checks to make sure all fields of the message conform to our standards.
-// ie highly probable email address, ban certain characters from other fields.
-func validateIncomingMessage(w http.ResponseWriter, inMsg incomingMessage) bool {
-	// I am choosing not to give hints about what is invalid back to client
-	// because if a field does not pass I know the user is bypassing validation I wrote on the frontend.
-	// Return an http error on first occurrence of bad value.
-	if !emailRegExp.MatchString(inMsg.Email) {
-		http.Error(w, "Request body contains an inappropriate value.", http.StatusBadRequest)
-		return false
-	}
-	if !textRegExp.MatchString(inMsg.Name) {
-		http.Error(w, "Request body contains an inappropriate value.", http.StatusBadRequest)
-		return false
-	}
-	if !textRegExp.MatchString(inMsg.Title) {
-		http.Error(w, "Request body contains an inappropriate value.", http.StatusBadRequest)
-		return false
-	}
-	if !textRegExp.MatchString(inMsg.Body) {
-		http.Error(w, "Request body contains an inappropriate value.", http.StatusBadRequest)
-		return false
+// writeValidationErrors writes errs to w as {"errors":[{"field":...,"reason":...}]}.
+func writeValidationErrors(w http.ResponseWriter, errs []fieldError) {
+	responseJSON, err := json.Marshal(validationErrors{Errors: errs})
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
 	}
-	return true
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	w.Write(responseJSON)
 }
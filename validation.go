@@ -0,0 +1,106 @@
+package main
+
+import (
+	"net/mail"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Per-field length limits. Generous enough for real names, subjects,
+// and messages while still bounding the email size.
+const (
+	minFieldLen = 1
+	maxNameLen  = 200
+	maxTitleLen = 200
+	maxBodyLen  = 10000
+)
+
+// fieldError reports that a single field on incomingMessage failed
+// validation, and why.
+type fieldError struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+}
+
+// validationErrors is the JSON body returned to the client when
+// validateIncomingMessage finds problems: {"errors":[{"field":...,"reason":...}]}.
+type validationErrors struct {
+	Errors []fieldError `json:"errors"`
+}
+
+// validateIncomingMessage checks Name, Email, Title, and Body against
+// our standards: printable Unicode text within a sane length, a
+// parseable email address, and no \r or \n in the fields that end up in
+// email headers (Name, Email, Title), regardless of whether the rest of
+// the text is otherwise printable. It returns one fieldError per
+// violation found rather than stopping at the first.
+func validateIncomingMessage(inMsg incomingMessage) []fieldError {
+	var errs []fieldError
+
+	if containsHeaderInjection(inMsg.Name) {
+		errs = append(errs, fieldError{"Name", "must not contain line breaks"})
+	} else if !hasValidLength(inMsg.Name, minFieldLen, maxNameLen) {
+		errs = append(errs, fieldError{"Name", "must be between 1 and 200 characters"})
+	} else if !isPrintableText(inMsg.Name, false) {
+		errs = append(errs, fieldError{"Name", "contains invalid characters"})
+	}
+
+	if containsHeaderInjection(inMsg.Email) {
+		errs = append(errs, fieldError{"Email", "must not contain line breaks"})
+	} else if _, err := mail.ParseAddress(inMsg.Email); err != nil {
+		errs = append(errs, fieldError{"Email", "invalid"})
+	}
+
+	if containsHeaderInjection(inMsg.Title) {
+		errs = append(errs, fieldError{"Title", "must not contain line breaks"})
+	} else if !hasValidLength(inMsg.Title, minFieldLen, maxTitleLen) {
+		errs = append(errs, fieldError{"Title", "must be between 1 and 200 characters"})
+	} else if !isPrintableText(inMsg.Title, false) {
+		errs = append(errs, fieldError{"Title", "contains invalid characters"})
+	}
+
+	if !hasValidLength(inMsg.Body, minFieldLen, maxBodyLen) {
+		errs = append(errs, fieldError{"Body", "must be between 1 and 10000 characters"})
+	} else if !isPrintableText(inMsg.Body, true) {
+		errs = append(errs, fieldError{"Body", "contains invalid characters"})
+	}
+
+	return errs
+}
+
+// containsHeaderInjection reports whether s contains a carriage return
+// or line feed, which would let a submitter inject extra headers into
+// the emails we build from Name/Email/Title.
+func containsHeaderInjection(s string) bool {
+	for _, r := range s {
+		if r == '\r' || r == '\n' {
+			return true
+		}
+	}
+	return false
+}
+
+// hasValidLength reports whether the rune count of s is within [min, max].
+func hasValidLength(s string, min, max int) bool {
+	n := utf8.RuneCountInString(s)
+	return n >= min && n <= max
+}
+
+// isPrintableText reports whether s is valid UTF-8 made up entirely of
+// printable characters (plus '\n' when allowNewlines is set). This
+// allows accents, CJK, emoji, and ordinary punctuation through, while
+// still rejecting control characters.
+func isPrintableText(s string, allowNewlines bool) bool {
+	if !utf8.ValidString(s) {
+		return false
+	}
+	for _, r := range s {
+		if r == '\n' && allowNewlines {
+			continue
+		}
+		if !unicode.IsPrint(r) {
+			return false
+		}
+	}
+	return true
+}
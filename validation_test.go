@@ -0,0 +1,57 @@
+package main
+
+import "testing"
+
+func TestValidateIncomingMessageAllowsUnicode(t *testing.T) {
+	inMsg := incomingMessage{
+		Name:  "Renée 田中 🙂",
+		Email: "renee@example.com",
+		Title: "Bonjour; à bientôt / see you soon",
+		Body:  "Ça va? 你好!\nLooking forward to it.",
+	}
+
+	if errs := validateIncomingMessage(inMsg); len(errs) != 0 {
+		t.Fatalf("expected unicode and punctuation-heavy fields to pass, got %v", errs)
+	}
+}
+
+func TestValidateIncomingMessageRejectsHeaderInjection(t *testing.T) {
+	inMsg := incomingMessage{
+		Name:  "Evil\r\nBcc: victim@example.com",
+		Email: "attacker@example.com",
+		Title: "Hi",
+		Body:  "Hello",
+	}
+
+	errs := validateIncomingMessage(inMsg)
+	if len(errs) != 1 || errs[0].Field != "Name" {
+		t.Fatalf("expected a single Name error for header injection, got %v", errs)
+	}
+}
+
+func TestValidateIncomingMessageRejectsInvalidEmail(t *testing.T) {
+	inMsg := incomingMessage{
+		Name:  "Ada",
+		Email: "not-an-email",
+		Title: "Hi",
+		Body:  "Hello",
+	}
+
+	errs := validateIncomingMessage(inMsg)
+	found := false
+	for _, e := range errs {
+		if e.Field == "Email" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("expected an Email error, got %v", errs)
+	}
+}
+
+func TestValidateIncomingMessageRejectsEmptyFields(t *testing.T) {
+	errs := validateIncomingMessage(incomingMessage{})
+	if len(errs) == 0 {
+		t.Fatal("expected errors for an entirely empty message")
+	}
+}